@@ -13,7 +13,9 @@
 package main
 
 import (
+  "context"
   "embed"
+  "encoding/json"
   "fmt"
   "io"
   "io/fs"
@@ -30,6 +32,11 @@ import (
 const (
   listenAddr = ":8080"
   worldSeed  = uint32(1337)
+  tickHz     = 20.0
+
+  // Frames buffered per /api/stream subscriber before World starts treating
+  // it as behind (see world.Subscribe's back-pressure/resync behavior).
+  streamBufferFrames = 32
 )
 
 // --- Embedded web UI ---
@@ -40,6 +47,14 @@ var webFS embed.FS
 func main() {
   w := world.NewWorld(worldSeed)
 
+  // Drives w.Step on a fixed schedule so subscribers have ticks to see
+  // deltas on. No systems are registered yet, so ticks are currently no-ops
+  // beyond bookkeeping; this is the seam future systems (machines, NPCs)
+  // plug into via w.RegisterSystem.
+  loopCtx, cancelLoop := context.WithCancel(context.Background())
+  defer cancelLoop()
+  go w.RunLoop(loopCtx, tickHz)
+
   // Static UI.
   sub, err := fs.Sub(webFS, "web")
   if err != nil {
@@ -47,22 +62,62 @@ func main() {
   }
   http.Handle("/", http.FileServer(http.FS(sub)))
 
-  // Minimal API: top-down surface snapshot (2KB/chunk).
+  // REST fallback: one chunk's full snapshot, same codec /api/stream's
+  // keyframes use.
   http.HandleFunc("/api/chunk", func(rw http.ResponseWriter, r *http.Request) {
-    cx := qI32(r, "cx", 0)
-    cy := qI32(r, "cy", 0)
-    cz := qI32(r, "cz", 0)
-
-    c := w.GetOrCreateChunk(chunk.ChunkCoord{X: cx, Y: cy, Z: cz})
+    coord := chunk.ChunkCoord{X: qI32(r, "cx", 0), Y: qI32(r, "cy", 0), Z: qI32(r, "cz", 0)}
 
     rw.Header().Set("Content-Type", "application/octet-stream")
     rw.Header().Set("Cache-Control", "no-store")
+    _, _ = rw.Write(w.Snapshot(coord))
+  })
 
-    // Layout: [1024] TopY (0..31), then [1024] TopType.
-    buf := make([]byte, chunk.CW*chunk.CD*2)
-    copy(buf[:chunk.CW*chunk.CD], c.TopY[:])
-    copy(buf[chunk.CW*chunk.CD:], c.TopType[:])
-    _, _ = rw.Write(buf)
+  // Streaming subscription: an initial keyframe per chunk in the requested
+  // region, then one NDJSON line per touched chunk per tick. WebSocket isn't
+  // worth a hand-rolled RFC6455 implementation for this, and the project
+  // has no external deps to pull one in from, so this is the SSE-style
+  // fallback the feature allows: plain chunked HTTP, flushed per frame.
+  http.HandleFunc("/api/stream", func(rw http.ResponseWriter, r *http.Request) {
+    flusher, ok := rw.(http.Flusher)
+    if !ok {
+      http.Error(rw, "streaming unsupported", http.StatusInternalServerError)
+      return
+    }
+
+    region := world.Region{
+      Min: chunk.ChunkCoord{X: qI32(r, "minX", 0), Y: qI32(r, "minY", 0), Z: qI32(r, "minZ", 0)},
+      Max: chunk.ChunkCoord{X: qI32(r, "maxX", 0), Y: qI32(r, "maxY", 0), Z: qI32(r, "maxZ", 0)},
+    }
+
+    frames := make(chan world.Frame, streamBufferFrames)
+    id, err := w.Subscribe(region, frames)
+    if err != nil {
+      http.Error(rw, err.Error(), http.StatusBadRequest)
+      return
+    }
+    defer w.Unsubscribe(id)
+
+    rw.Header().Set("Content-Type", "application/x-ndjson")
+    rw.Header().Set("Cache-Control", "no-store")
+    rw.WriteHeader(http.StatusOK)
+
+    enc := json.NewEncoder(rw)
+    ctx := r.Context()
+    for {
+      select {
+      case <-ctx.Done():
+        return
+      case f := <-frames:
+        if err := enc.Encode(streamFrame{
+          X: f.Coord.X, Y: f.Coord.Y, Z: f.Coord.Z,
+          Kind: frameKindName(f.Kind),
+          Data: f.Data,
+        }); err != nil {
+          return
+        }
+        flusher.Flush()
+      }
+    }
   })
 
   // Tiny health endpoint.
@@ -77,6 +132,24 @@ func main() {
 
 // --- Helpers ---
 
+// streamFrame is the NDJSON wire shape for /api/stream. Data is raw codec
+// bytes (chunk.EncodeChunkSnapshot or chunk.EncodeDeltaBatch output);
+// encoding/json base64-encodes a []byte field automatically.
+type streamFrame struct {
+  X    int32  `json:"x"`
+  Y    int32  `json:"y"`
+  Z    int32  `json:"z"`
+  Kind string `json:"kind"`
+  Data []byte `json:"data"`
+}
+
+func frameKindName(k world.FrameKind) string {
+  if k == world.FrameKeyframe {
+    return "keyframe"
+  }
+  return "delta"
+}
+
 func qI32(r *http.Request, key string, def int32) int32 {
   s := r.URL.Query().Get(key)
   if s == "" {
@@ -7,6 +7,8 @@
 
 package chunk
 
+import "sync"
+
 // --- Constants ---
 
 const (
@@ -33,6 +35,11 @@ type ChunkCoord struct{ X, Y, Z int32 }
 type Chunk struct {
   C ChunkCoord
 
+  // mu guards everything below: a Chunk is shared between the tick
+  // goroutine (which mutates it via Set/SetTypeIdx) and any number of
+  // readers (codec encode, HTTP handlers) running concurrently with it.
+  mu sync.RWMutex
+
   // Dense voxel data (SoA)
   Type [N]uint8
   Meta [N]uint8
@@ -86,6 +93,26 @@ func IdxFromPacked(p uint16) int { return int(p) }
 // RebuildTopCache recomputes TopY/TopType for the chunk.
 // Cost: CW*CD*CH = 32768 checks (tiny for 32^3).
 func (c *Chunk) RebuildTopCache() {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  c.rebuildTopCacheLocked()
+}
+
+// EnsureTopCache rebuilds the top cache only if it's currently stale. Unlike
+// a bare "if !c.TopValid { c.RebuildTopCache() }" at the call site, the
+// check and the rebuild happen under the same lock, so a concurrent Set
+// can't slip in between them.
+func (c *Chunk) EnsureTopCache() {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  if c.TopValid {
+    return
+  }
+  c.rebuildTopCacheLocked()
+}
+
+// rebuildTopCacheLocked is RebuildTopCache's body; callers must hold c.mu.
+func (c *Chunk) rebuildTopCacheLocked() {
   for z := 0; z < CD; z++ {
     for x := 0; x < CW; x++ {
       col := x + z*CW
@@ -1,28 +1,532 @@
 // internal/chunk/codec.go
 // Purpose: serialization/deserialization for chunks + compression.
 // Keep format versioned from day 1 (v1 type-only, v2 type+meta, etc.)
+//
+// v2 adds content-defined chunking (CDC): the concatenated Type||Meta stream
+// is cut into variable-length segments on a rolling-hash boundary, each
+// segment is addressed by a strong hash, and segments already known to the
+// peer/disk are referenced instead of resent. This is what lets huge runs of
+// identical terrain (stone, water, generated columns repeated across the
+// world) dedupe instead of shipping a full 64KB raw buffer every time.
+// v1 (full raw Type+Meta) is kept as a fallback so old snapshots still decode.
 
 package chunk
 
 // --- Imports ---
-//
-// TODO
+
+import (
+  "bytes"
+  "encoding/binary"
+  "errors"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "sync"
+
+  "github.com/Conwinds/NPCSim/internal/mathx"
+)
 
 // --- Constants ---
-//
-// TODO: format version tags
+
+const (
+  // Format version tags.
+  FormatV1Raw = uint8(1) // full raw Type+Meta dump, no dedup
+  FormatV2CDC = uint8(2) // content-defined chunking + CAS segment refs
+
+  // Rolling hash window and chunk size bounds, tuned for the 65536-byte
+  // (Type||Meta) stream of a 32^3 chunk.
+  rollWindow = 48
+  minSegment = 512
+  maxSegment = 8192
+
+  // A segment boundary is cut where the low cdcMaskBits bits of the rolling
+  // checksum are all zero. 2^12 averages ~4KB segments, comfortably inside
+  // [minSegment,maxSegment] before the max-size clamp has to kick in.
+  cdcMaskBits = 12
+  cdcMask     = uint32(1<<cdcMaskBits) - 1
+
+  // Segment entry tags (wire format, see buildEntries/decodeEntries).
+  segTagRLE     = uint8(0) // single repeated byte, e.g. all-air/all-stone runs
+  segTagRef     = uint8(1) // hash only; store already has the bytes
+  segTagLiteral = uint8(2) // hash + inline bytes; store doesn't have it yet
+)
 
 // --- Types ---
-//
-// TODO: encoder/decoder options
+
+// SegmentHash is a 128-bit content hash over a CDC segment. Built from
+// chained mathx.Hash32 lanes rather than a standalone crypto hash, since a
+// single world's worth of chunk data never gets close to birthday-bound
+// collision territory and this keeps the codec dependency-free.
+type SegmentHash [16]byte
+
+// ChunkStore is the content-addressed backend for deduped segments.
+// Segments are immutable once stored, so Put is expected to be idempotent.
+type ChunkStore interface {
+  Has(h SegmentHash) bool
+  Get(h SegmentHash) ([]byte, bool)
+  Put(h SegmentHash, data []byte)
+}
+
+// MemChunkStore is an in-memory ChunkStore. Good for tests and for a single
+// server process that keeps the whole world resident.
+type MemChunkStore struct {
+  mu   sync.RWMutex
+  data map[SegmentHash][]byte
+}
+
+// FileChunkStore is a file-backed ChunkStore: one file per segment, named by
+// its hash, under Dir. Simple and good enough for a single-writer world
+// process; durability/fsync hardening can come later.
+type FileChunkStore struct {
+  Dir string
+  mu  sync.Mutex
+}
+
+// --- Constructors ---
+
+func NewMemChunkStore() *MemChunkStore {
+  return &MemChunkStore{data: make(map[SegmentHash][]byte, 1024)}
+}
+
+func NewFileChunkStore(dir string) *FileChunkStore {
+  return &FileChunkStore{Dir: dir}
+}
 
 // --- Public methods ---
-//
-// TODO: EncodeChunkSnapshot
-// TODO: DecodeChunkSnapshot
-// TODO: EncodeDeltaBatch (changed blocks)
-// TODO: DecodeDeltaBatch
+
+func (s *MemChunkStore) Has(h SegmentHash) bool {
+  s.mu.RLock()
+  _, ok := s.data[h]
+  s.mu.RUnlock()
+  return ok
+}
+
+func (s *MemChunkStore) Get(h SegmentHash) ([]byte, bool) {
+  s.mu.RLock()
+  d, ok := s.data[h]
+  s.mu.RUnlock()
+  return d, ok
+}
+
+func (s *MemChunkStore) Put(h SegmentHash, data []byte) {
+  s.mu.Lock()
+  if _, ok := s.data[h]; !ok {
+    cp := make([]byte, len(data))
+    copy(cp, data)
+    s.data[h] = cp
+  }
+  s.mu.Unlock()
+}
+
+func (s *FileChunkStore) Has(h SegmentHash) bool {
+  _, err := os.Stat(s.path(h))
+  return err == nil
+}
+
+func (s *FileChunkStore) Get(h SegmentHash) ([]byte, bool) {
+  b, err := os.ReadFile(s.path(h))
+  if err != nil {
+    return nil, false
+  }
+  return b, true
+}
+
+func (s *FileChunkStore) Put(h SegmentHash, data []byte) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+
+  p := s.path(h)
+  if _, err := os.Stat(p); err == nil {
+    return // already on disk
+  }
+  if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+    return
+  }
+  // Write-then-rename so a crash mid-write can't leave a half-written
+  // segment that later Get calls would trust.
+  tmp := p + ".tmp"
+  if err := os.WriteFile(tmp, data, 0o644); err != nil {
+    return
+  }
+  _ = os.Rename(tmp, p)
+}
+
+// EncodeChunkSnapshot encodes the full state of c. With a non-nil store it
+// uses the v2 CDC format (segments already in store are referenced by hash
+// only); with a nil store it falls back to the v1 raw format.
+func EncodeChunkSnapshot(c *Chunk, store ChunkStore) []byte {
+  var buf bytes.Buffer
+  if store == nil {
+    buf.WriteByte(FormatV1Raw)
+    writeCoord(&buf, c.C)
+    c.mu.RLock()
+    buf.Write(c.Type[:])
+    buf.Write(c.Meta[:])
+    c.mu.RUnlock()
+    return buf.Bytes()
+  }
+
+  buf.WriteByte(FormatV2CDC)
+  writeCoord(&buf, c.C)
+  buf.Write(buildEntries(concatStream(c), store))
+  return buf.Bytes()
+}
+
+// DecodeChunkSnapshot decodes a buffer produced by EncodeChunkSnapshot. store
+// is required for v2 snapshots (to resolve segment refs and to learn any
+// inline literals) and ignored for v1.
+func DecodeChunkSnapshot(raw []byte, store ChunkStore) (*Chunk, error) {
+  r := bytes.NewReader(raw)
+  version, err := r.ReadByte()
+  if err != nil {
+    return nil, fmt.Errorf("chunk: truncated snapshot: %w", err)
+  }
+  coord, err := readCoord(r)
+  if err != nil {
+    return nil, fmt.Errorf("chunk: snapshot coord: %w", err)
+  }
+  c := New(coord)
+
+  switch version {
+  case FormatV1Raw:
+    if _, err := io.ReadFull(r, c.Type[:]); err != nil {
+      return nil, fmt.Errorf("chunk: v1 type: %w", err)
+    }
+    if _, err := io.ReadFull(r, c.Meta[:]); err != nil {
+      return nil, fmt.Errorf("chunk: v1 meta: %w", err)
+    }
+  case FormatV2CDC:
+    if store == nil {
+      return nil, errors.New("chunk: v2 snapshot needs a ChunkStore")
+    }
+    out := make([]byte, 2*N)
+    if err := decodeEntries(r, store, out); err != nil {
+      return nil, err
+    }
+    copy(c.Type[:], out[:N])
+    copy(c.Meta[:], out[N:])
+  default:
+    return nil, fmt.Errorf("chunk: unknown snapshot format %d", version)
+  }
+
+  c.RebuildTopCache()
+  return c, nil
+}
+
+// EncodeDeltaBatch encodes the current full state of each chunk in chunks as
+// one batch, in order. Because segment references are content-addressed,
+// chunks that only changed a little reuse almost every segment already held
+// by the peer/disk store, so the wire cost tracks the size of the actual
+// edit rather than the chunk's raw 64KB footprint. chunks is expected to be
+// the set dirtied since the last batch (see world.TickCommitBuffer).
+func EncodeDeltaBatch(chunks []*Chunk, store ChunkStore) []byte {
+  var buf bytes.Buffer
+  buf.WriteByte(FormatV2CDC)
+  putUvarint(&buf, uint64(len(chunks)))
+  for _, c := range chunks {
+    writeCoord(&buf, c.C)
+    buf.Write(buildEntries(concatStream(c), store))
+  }
+  return buf.Bytes()
+}
+
+// DecodeDeltaBatch decodes a buffer produced by EncodeDeltaBatch into fresh
+// *Chunk values (one per entry, in wire order). Callers merge these into
+// their own chunk map; DecodeDeltaBatch never mutates store beyond learning
+// any inline literals it is handed.
+func DecodeDeltaBatch(raw []byte, store ChunkStore) ([]*Chunk, error) {
+  if store == nil {
+    return nil, errors.New("chunk: delta batch needs a ChunkStore")
+  }
+  r := bytes.NewReader(raw)
+  version, err := r.ReadByte()
+  if err != nil {
+    return nil, fmt.Errorf("chunk: truncated delta batch: %w", err)
+  }
+  if version != FormatV2CDC {
+    return nil, fmt.Errorf("chunk: unsupported delta batch format %d", version)
+  }
+  numChunks, err := binary.ReadUvarint(r)
+  if err != nil {
+    return nil, fmt.Errorf("chunk: delta batch count: %w", err)
+  }
+
+  out := make([]*Chunk, 0, numChunks)
+  for i := uint64(0); i < numChunks; i++ {
+    coord, err := readCoord(r)
+    if err != nil {
+      return nil, fmt.Errorf("chunk: delta batch coord: %w", err)
+    }
+    buf := make([]byte, 2*N)
+    if err := decodeEntries(r, store, buf); err != nil {
+      return nil, err
+    }
+    c := New(coord)
+    copy(c.Type[:], buf[:N])
+    copy(c.Meta[:], buf[N:])
+    c.RebuildTopCache()
+    out = append(out, c)
+  }
+  return out, nil
+}
+
+// NegotiateHaves reports which of hashes are NOT present in store, i.e. what
+// a sender still has to ship as inline literals before a CDC-encoded
+// snapshot for coord can be decoded on the receiving end. coord is not used
+// in the lookup. Nothing calls this yet: /api/stream sends its frames without
+// a have/need exchange.
+func NegotiateHaves(store ChunkStore, coord ChunkCoord, hashes []SegmentHash) []SegmentHash {
+  missing := make([]SegmentHash, 0, len(hashes))
+  for _, h := range hashes {
+    if !store.Has(h) {
+      missing = append(missing, h)
+    }
+  }
+  return missing
+}
 
 // --- Private helpers ---
-//
-// TODO: RLE, varints, checksum (optional)
+
+func (s *FileChunkStore) path(h SegmentHash) string {
+  return filepath.Join(s.Dir, fmt.Sprintf("%x.seg", h[:]))
+}
+
+// concatStream returns the Type||Meta stream a *Chunk encodes over.
+func concatStream(c *Chunk) []byte {
+  c.mu.RLock()
+  defer c.mu.RUnlock()
+  out := make([]byte, 2*N)
+  copy(out[:N], c.Type[:])
+  copy(out[N:], c.Meta[:])
+  return out
+}
+
+// buildEntries cuts data into CDC segments and encodes them as a
+// varint-prefixed entry list: all-same-byte runs become RLE entries, known
+// segments become hash-only refs, and unknown segments become literals
+// (learned into store as a side effect).
+func buildEntries(data []byte, store ChunkStore) []byte {
+  var buf bytes.Buffer
+  bounds := cdcBoundaries(data)
+  putUvarint(&buf, uint64(len(bounds)))
+
+  start := 0
+  for _, end := range bounds {
+    seg := data[start:end]
+    start = end
+
+    if isUniform(seg) {
+      buf.WriteByte(segTagRLE)
+      buf.WriteByte(seg[0])
+      putUvarint(&buf, uint64(len(seg)))
+      continue
+    }
+
+    h := hashSegment(seg)
+    if store.Has(h) {
+      buf.WriteByte(segTagRef)
+      buf.Write(h[:])
+      putUvarint(&buf, uint64(len(seg)))
+      continue
+    }
+
+    store.Put(h, seg)
+    buf.WriteByte(segTagLiteral)
+    buf.Write(h[:])
+    putUvarint(&buf, uint64(len(seg)))
+    buf.Write(seg)
+  }
+  return buf.Bytes()
+}
+
+// decodeEntries reads an entry list written by buildEntries and reconstructs
+// the original stream into out (which must be sized for the full stream).
+func decodeEntries(r *bytes.Reader, store ChunkStore, out []byte) error {
+  numSegs, err := binary.ReadUvarint(r)
+  if err != nil {
+    return fmt.Errorf("chunk: entry count: %w", err)
+  }
+
+  pos := 0
+  for i := uint64(0); i < numSegs; i++ {
+    tag, err := r.ReadByte()
+    if err != nil {
+      return fmt.Errorf("chunk: entry tag: %w", err)
+    }
+
+    switch tag {
+    case segTagRLE:
+      val, err := r.ReadByte()
+      if err != nil {
+        return fmt.Errorf("chunk: rle value: %w", err)
+      }
+      ln, err := binary.ReadUvarint(r)
+      if err != nil {
+        return fmt.Errorf("chunk: rle length: %w", err)
+      }
+      if pos+int(ln) > len(out) {
+        return errors.New("chunk: rle run overruns stream")
+      }
+      for j := 0; j < int(ln); j++ {
+        out[pos+j] = val
+      }
+      pos += int(ln)
+
+    case segTagRef:
+      var h SegmentHash
+      if _, err := io.ReadFull(r, h[:]); err != nil {
+        return fmt.Errorf("chunk: ref hash: %w", err)
+      }
+      ln, err := binary.ReadUvarint(r)
+      if err != nil {
+        return fmt.Errorf("chunk: ref length: %w", err)
+      }
+      data, ok := store.Get(h)
+      if !ok {
+        return fmt.Errorf("chunk: missing segment %x in store", h[:])
+      }
+      if pos+int(ln) > len(out) || len(data) != int(ln) {
+        return errors.New("chunk: ref segment size mismatch")
+      }
+      copy(out[pos:pos+int(ln)], data)
+      pos += int(ln)
+
+    case segTagLiteral:
+      var h SegmentHash
+      if _, err := io.ReadFull(r, h[:]); err != nil {
+        return fmt.Errorf("chunk: literal hash: %w", err)
+      }
+      ln, err := binary.ReadUvarint(r)
+      if err != nil {
+        return fmt.Errorf("chunk: literal length: %w", err)
+      }
+      if pos+int(ln) > len(out) {
+        return errors.New("chunk: literal overruns stream")
+      }
+      seg := out[pos : pos+int(ln)]
+      if _, err := io.ReadFull(r, seg); err != nil {
+        return fmt.Errorf("chunk: literal data: %w", err)
+      }
+      store.Put(h, seg)
+      pos += int(ln)
+
+    default:
+      return fmt.Errorf("chunk: unknown entry tag %d", tag)
+    }
+  }
+  if pos != len(out) {
+    return fmt.Errorf("chunk: decoded %d bytes, want %d", pos, len(out))
+  }
+  return nil
+}
+
+// isUniform reports whether every byte in seg is identical (the RLE
+// fast-path: all-air and all-stone runs are extremely common in generated
+// terrain).
+func isUniform(seg []byte) bool {
+  if len(seg) == 0 {
+    return true
+  }
+  v := seg[0]
+  for _, b := range seg[1:] {
+    if b != v {
+      return false
+    }
+  }
+  return true
+}
+
+// hashSegment computes a 128-bit content hash for seg from four chained
+// mathx.Hash32 lanes, each folding the segment in 4-byte words.
+func hashSegment(seg []byte) SegmentHash {
+  var h SegmentHash
+  lanes := [4]uint32{0x9E3779B9, 0x85EBCA6B, 0xC2B2AE35, 0x27D4EB2F}
+  for lane, seed := range lanes {
+    acc := seed ^ uint32(len(seg))
+    for i := 0; i < len(seg); i += 4 {
+      var word uint32
+      for j := 0; j < 4 && i+j < len(seg); j++ {
+        word |= uint32(seg[i+j]) << (8 * uint(j))
+      }
+      acc = mathx.Hash32(acc ^ word ^ uint32(i))
+    }
+    binary.LittleEndian.PutUint32(h[lane*4:], acc)
+  }
+  return h
+}
+
+// rollHash is a Rabin-style rolling checksum (rsync weak-checksum style)
+// over a fixed rollWindow-byte window: sum1 is the sum of bytes in the
+// window, sum2 is the sum of bytes weighted by distance from the window
+// start, both mod 2^16.
+type rollHash struct {
+  window [rollWindow]byte
+  pos    int
+  sum1   uint32
+  sum2   uint32
+}
+
+func (r *rollHash) push(b byte) {
+  old := r.window[r.pos]
+  r.window[r.pos] = b
+  r.pos++
+  if r.pos == rollWindow {
+    r.pos = 0
+  }
+
+  prevSum1 := r.sum1
+  r.sum1 = (r.sum1 - uint32(old) + uint32(b)) & 0xFFFF
+  r.sum2 = (r.sum2 - uint32(rollWindow+1)*uint32(old) + prevSum1 + uint32(b)) & 0xFFFF
+}
+
+// cdcBoundaries returns the exclusive end offsets of each content-defined
+// segment of data, honoring [minSegment,maxSegment].
+func cdcBoundaries(data []byte) []int {
+  if len(data) == 0 {
+    return nil
+  }
+
+  var bounds []int
+  var rh rollHash
+  segStart := 0
+  for i, b := range data {
+    rh.push(b)
+    segLen := i - segStart + 1
+
+    if segLen >= maxSegment {
+      bounds = append(bounds, i+1)
+      segStart = i + 1
+      rh = rollHash{}
+      continue
+    }
+    if segLen < minSegment {
+      continue
+    }
+    if (rh.sum1<<16|rh.sum2)&cdcMask == 0 {
+      bounds = append(bounds, i+1)
+      segStart = i + 1
+      rh = rollHash{}
+    }
+  }
+  if segStart < len(data) {
+    bounds = append(bounds, len(data))
+  }
+  return bounds
+}
+
+func putUvarint(buf *bytes.Buffer, v uint64) {
+  var tmp [binary.MaxVarintLen64]byte
+  n := binary.PutUvarint(tmp[:], v)
+  buf.Write(tmp[:n])
+}
+
+func writeCoord(buf *bytes.Buffer, c ChunkCoord) {
+  _ = binary.Write(buf, binary.BigEndian, c)
+}
+
+func readCoord(r *bytes.Reader) (ChunkCoord, error) {
+  var c ChunkCoord
+  err := binary.Read(r, binary.BigEndian, &c)
+  return c, err
+}
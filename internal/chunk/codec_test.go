@@ -0,0 +1,160 @@
+// internal/chunk/codec_test.go
+// Purpose: round-trip and dedup coverage for the CDC codec (rolling-hash
+// boundaries, RLE/ref/literal tagging, store round-trip).
+
+package chunk
+
+import (
+  "bytes"
+  "testing"
+
+  "github.com/Conwinds/NPCSim/internal/mathx"
+)
+
+// fillPseudoRandom writes deterministic, non-uniform content into c so CDC
+// boundary-cutting has something to chew on (an all-zero/all-same chunk only
+// ever exercises the RLE fast path).
+func fillPseudoRandom(c *Chunk, seed uint32) {
+  for i := 0; i < N; i++ {
+    h := mathx.Hash32(seed ^ uint32(i))
+    c.Type[i] = uint8(h)
+    c.Meta[i] = uint8(h >> 8)
+  }
+}
+
+func TestChunkSnapshotRoundTripV1(t *testing.T) {
+  c := New(ChunkCoord{X: 1, Y: -2, Z: 3})
+  fillPseudoRandom(c, 42)
+
+  raw := EncodeChunkSnapshot(c, nil)
+  got, err := DecodeChunkSnapshot(raw, nil)
+  if err != nil {
+    t.Fatalf("decode: %v", err)
+  }
+  if got.C != c.C {
+    t.Fatalf("coord = %+v, want %+v", got.C, c.C)
+  }
+  if !bytes.Equal(got.Type[:], c.Type[:]) || !bytes.Equal(got.Meta[:], c.Meta[:]) {
+    t.Fatal("type/meta mismatch after v1 round trip")
+  }
+}
+
+func TestChunkSnapshotRoundTripV2(t *testing.T) {
+  store := NewMemChunkStore()
+  c := New(ChunkCoord{X: 7, Y: 0, Z: -9})
+  fillPseudoRandom(c, 99)
+
+  raw := EncodeChunkSnapshot(c, store)
+  if raw[0] != FormatV2CDC {
+    t.Fatalf("format byte = %d, want FormatV2CDC", raw[0])
+  }
+  got, err := DecodeChunkSnapshot(raw, store)
+  if err != nil {
+    t.Fatalf("decode: %v", err)
+  }
+  if got.C != c.C {
+    t.Fatalf("coord = %+v, want %+v", got.C, c.C)
+  }
+  if !bytes.Equal(got.Type[:], c.Type[:]) || !bytes.Equal(got.Meta[:], c.Meta[:]) {
+    t.Fatal("type/meta mismatch after v2 round trip")
+  }
+  if !got.TopValid {
+    t.Fatal("decoded chunk should have its top cache rebuilt")
+  }
+}
+
+func TestDeltaBatchRoundTrip(t *testing.T) {
+  store := NewMemChunkStore()
+  chunks := []*Chunk{
+    New(ChunkCoord{X: 0, Y: 0, Z: 0}),
+    New(ChunkCoord{X: 1, Y: 0, Z: 0}),
+    New(ChunkCoord{X: 2, Y: 0, Z: 0}),
+  }
+  for i, c := range chunks {
+    fillPseudoRandom(c, uint32(i+1)*1000)
+  }
+
+  raw := EncodeDeltaBatch(chunks, store)
+  got, err := DecodeDeltaBatch(raw, store)
+  if err != nil {
+    t.Fatalf("decode: %v", err)
+  }
+  if len(got) != len(chunks) {
+    t.Fatalf("got %d chunks, want %d", len(got), len(chunks))
+  }
+  for i, want := range chunks {
+    if got[i].C != want.C {
+      t.Fatalf("chunk %d coord = %+v, want %+v", i, got[i].C, want.C)
+    }
+    if !bytes.Equal(got[i].Type[:], want.Type[:]) || !bytes.Equal(got[i].Meta[:], want.Meta[:]) {
+      t.Fatalf("chunk %d type/meta mismatch", i)
+    }
+  }
+}
+
+func TestDedupSharesSegments(t *testing.T) {
+  store := NewMemChunkStore()
+  a := New(ChunkCoord{X: 0, Y: 0, Z: 0})
+  fillPseudoRandom(a, 5)
+  b := New(ChunkCoord{X: 1, Y: 0, Z: 0})
+  fillPseudoRandom(b, 5) // identical content, different coord
+
+  rawA := EncodeChunkSnapshot(a, store)
+  sizeAfterA := store.size()
+
+  rawB := EncodeChunkSnapshot(b, store)
+  sizeAfterB := store.size()
+
+  if sizeAfterB != sizeAfterA {
+    t.Fatalf("store grew from %d to %d segments encoding an identical chunk; want no new segments", sizeAfterA, sizeAfterB)
+  }
+  if len(rawB) >= len(rawA) {
+    t.Fatalf("second encode (%d bytes) should be cheaper than the first (%d bytes) once segments are deduped", len(rawB), len(rawA))
+  }
+}
+
+func TestRLEFastPath(t *testing.T) {
+  store := NewMemChunkStore()
+  c := New(ChunkCoord{}) // Type/Meta are zero-initialized: one giant uniform run
+
+  raw := EncodeChunkSnapshot(c, store)
+  if store.size() != 0 {
+    t.Fatalf("an all-zero chunk should encode entirely via RLE, storing 0 segments; got %d", store.size())
+  }
+  got, err := DecodeChunkSnapshot(raw, store)
+  if err != nil {
+    t.Fatalf("decode: %v", err)
+  }
+  if !bytes.Equal(got.Type[:], c.Type[:]) || !bytes.Equal(got.Meta[:], c.Meta[:]) {
+    t.Fatal("type/meta mismatch after RLE round trip")
+  }
+}
+
+func TestNegotiateHaves(t *testing.T) {
+  store := NewMemChunkStore()
+  have := hashSegment([]byte("already known"))
+  store.Put(have, []byte("already known"))
+  missing := hashSegment([]byte("never seen"))
+
+  got := NegotiateHaves(store, ChunkCoord{}, []SegmentHash{have, missing})
+  if len(got) != 1 || got[0] != missing {
+    t.Fatalf("NegotiateHaves = %v, want only %v", got, missing)
+  }
+}
+
+func TestDecodeRejectsUnknownVersion(t *testing.T) {
+  var buf bytes.Buffer
+  buf.WriteByte(99)
+  writeCoord(&buf, ChunkCoord{})
+
+  if _, err := DecodeChunkSnapshot(buf.Bytes(), nil); err == nil {
+    t.Fatal("expected an error for an unknown format version")
+  }
+}
+
+// size reports how many segments are currently stored, for dedup assertions.
+func (s *MemChunkStore) size() int {
+  s.mu.RLock()
+  defer s.mu.RUnlock()
+  return len(s.data)
+}
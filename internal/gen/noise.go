@@ -41,6 +41,43 @@ func hash01(seed uint32, x, z int32) float64 {
   return float64(h>>8) / float64(1<<24)
 }
 
+// noise3D is noise2D's 3D counterpart (trilinear interpolation of hashed
+// lattice corners), used for carving caves through the Type volume.
+func noise3D(wx, wy, wz int32, seed uint32, cell int32) float64 {
+  x0 := floorDiv(wx, cell) * cell
+  y0 := floorDiv(wy, cell) * cell
+  z0 := floorDiv(wz, cell) * cell
+  x1, y1, z1 := x0+cell, y0+cell, z0+cell
+
+  u := fade(float64(wx-x0) / float64(cell))
+  v := fade(float64(wy-y0) / float64(cell))
+  w := fade(float64(wz-z0) / float64(cell))
+
+  v000 := hash013(seed, x0, y0, z0)
+  v100 := hash013(seed, x1, y0, z0)
+  v010 := hash013(seed, x0, y1, z0)
+  v110 := hash013(seed, x1, y1, z0)
+  v001 := hash013(seed, x0, y0, z1)
+  v101 := hash013(seed, x1, y0, z1)
+  v011 := hash013(seed, x0, y1, z1)
+  v111 := hash013(seed, x1, y1, z1)
+
+  a := lerp(v000, v100, u)
+  b := lerp(v010, v110, u)
+  lo := lerp(a, b, v)
+
+  c := lerp(v001, v101, u)
+  d := lerp(v011, v111, u)
+  hi := lerp(c, d, v)
+
+  return lerp(lo, hi, w)
+}
+
+func hash013(seed uint32, x, y, z int32) float64 {
+  h := mathx.Hash3(seed, x, y, z)
+  return float64(h>>8) / float64(1<<24)
+}
+
 func lerp(a, b, t float64) float64 { return a + (b-a)*t }
 
 func fade(t float64) float64 {
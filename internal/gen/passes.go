@@ -0,0 +1,381 @@
+// internal/gen/passes.go
+// Purpose: the concrete Pass implementations the default pipeline registers.
+
+package gen
+
+import (
+  "sync"
+
+  "github.com/Conwinds/NPCSim/internal/chunk"
+  "github.com/Conwinds/NPCSim/internal/mathx"
+)
+
+// --- Constants ---
+
+const (
+  numBiomes     = 4
+  biomeCellSize = int32(64) // world-space Voronoi cell size for biome regions
+
+  // Biome id is stashed in the high nibble of Meta; the low nibble is still
+  // free for whatever a block wants to use it for.
+  biomeMetaShift = 4
+  biomeMetaMask  = uint8(0x0F)
+
+  caveNoiseCell  = int32(12)
+  caveSkinDepth  = int32(3) // min depth below the surface before caves are eligible
+  caveMaxBonus   = int32(18)
+  caveBaseThresh = 0.55
+  caveFalloff    = 0.018 // threshold drops per block of depth, floor at ~0.2
+
+  treeChance    = 37 // 1-in-N columns attempt a tree, hash-gated
+  rockChance    = 61
+  trunkMinH     = 3
+  trunkMaxH     = 5
+)
+
+// --- Types ---
+
+// PassTerrain fills base solids: grass/dirt/stone stratified by depth below
+// the column's noise-driven height.
+type PassTerrain struct{}
+
+// PassSeaFill floods any column below sea level up to seaLevel with water.
+type PassSeaFill struct{}
+
+// PassBiome assigns a Voronoi-ish biome region to every column and stamps
+// its id into the high nibble of each non-air voxel's Meta (water included).
+type PassBiome struct{}
+
+// PassCaves carves air pockets deep underground via thresholded 3D noise,
+// leaving a solid skin under the surface/seabed so a cave never breaches
+// into open water or daylight.
+type PassCaves struct{}
+
+// PassStructures places small deterministic features (trees, rocks) on
+// suitable surface columns, plus any writes into this chunk queued by a
+// neighbor's tree canopy overhanging the boundary.
+type PassStructures struct{}
+
+// structureHint is a single cross-chunk write: a position inside some other
+// (not-yet-generated) chunk that PassStructures should apply once that
+// chunk is generated.
+type structureHint struct {
+  Packed uint16
+  Type   uint8
+  Meta   uint8
+}
+
+// structureHints is the pending cross-chunk write queue, shared by every
+// chunk a Pipeline generates. It only helps when the target chunk is
+// generated after the hint is queued; a chunk generated earlier than its
+// neighbor's tree never sees that tree's overhang, same as real terrain gen
+// engines that accept a one-sided seam rather than re-visiting old chunks.
+type structureHints struct {
+  mu      sync.Mutex
+  pending map[chunk.ChunkCoord][]structureHint
+}
+
+func newStructureHints() *structureHints {
+  return &structureHints{pending: make(map[chunk.ChunkCoord][]structureHint)}
+}
+
+func (h *structureHints) push(target chunk.ChunkCoord, hint structureHint) {
+  h.mu.Lock()
+  h.pending[target] = append(h.pending[target], hint)
+  h.mu.Unlock()
+}
+
+func (h *structureHints) take(target chunk.ChunkCoord) []structureHint {
+  h.mu.Lock()
+  defer h.mu.Unlock()
+  hints := h.pending[target]
+  delete(h.pending, target)
+  return hints
+}
+
+// --- Public methods ---
+
+func (PassTerrain) Name() string     { return "terrain" }
+func (PassTerrain) ID() uint8        { return 1 }
+func (PassTerrain) Reads() []string  { return nil }
+func (PassTerrain) Writes() []string { return []string{"terrain"} }
+
+func (PassTerrain) Apply(c *chunk.Chunk, ctx PassCtx) {
+  baseY := int32(ctx.Coord.Y) * chunk.CH
+
+  for z := uint8(0); z < chunk.CD; z++ {
+    wz := int32(ctx.Coord.Z)*chunk.CD + int32(z)
+    for x := uint8(0); x < chunk.CW; x++ {
+      wx := int32(ctx.Coord.X)*chunk.CW + int32(x)
+      h := terrainHeight(wx, wz, ctx.Seed)
+
+      for y := uint8(0); y < chunk.CH; y++ {
+        gy := baseY + int32(y)
+        idx := chunk.Idx(x, y, z)
+
+        if gy > h {
+          c.Type[idx] = BlockAir
+          continue
+        }
+
+        depth := h - gy
+        switch {
+        case depth == 0:
+          c.Type[idx] = BlockGrass
+        case depth <= 3:
+          c.Type[idx] = BlockDirt
+        default:
+          c.Type[idx] = BlockStone
+        }
+      }
+    }
+  }
+}
+
+func (PassSeaFill) Name() string     { return "sea_fill" }
+func (PassSeaFill) ID() uint8        { return 2 }
+func (PassSeaFill) Reads() []string  { return []string{"terrain"} }
+func (PassSeaFill) Writes() []string { return []string{"water"} }
+
+func (PassSeaFill) Apply(c *chunk.Chunk, ctx PassCtx) {
+  baseY := int32(ctx.Coord.Y) * chunk.CH
+
+  for z := uint8(0); z < chunk.CD; z++ {
+    wz := int32(ctx.Coord.Z)*chunk.CD + int32(z)
+    for x := uint8(0); x < chunk.CW; x++ {
+      wx := int32(ctx.Coord.X)*chunk.CW + int32(x)
+      h := terrainHeight(wx, wz, ctx.Seed)
+      if h >= seaLevel {
+        continue
+      }
+
+      for gy := h + 1; gy <= seaLevel; gy++ {
+        if gy < baseY || gy >= baseY+chunk.CH {
+          continue
+        }
+        y := uint8(gy - baseY)
+        idx := chunk.Idx(x, y, z)
+        c.Type[idx] = BlockWater
+      }
+    }
+  }
+}
+
+func (PassBiome) Name() string     { return "biome" }
+func (PassBiome) ID() uint8        { return 3 }
+func (PassBiome) Reads() []string  { return []string{"terrain"} }
+func (PassBiome) Writes() []string { return []string{"biome"} }
+
+func (PassBiome) Apply(c *chunk.Chunk, ctx PassCtx) {
+  for z := uint8(0); z < chunk.CD; z++ {
+    wz := int32(ctx.Coord.Z)*chunk.CD + int32(z)
+    for x := uint8(0); x < chunk.CW; x++ {
+      wx := int32(ctx.Coord.X)*chunk.CW + int32(x)
+      biome := biomeAt(ctx.Seed, wx, wz)
+
+      for y := uint8(0); y < chunk.CH; y++ {
+        idx := chunk.Idx(x, y, z)
+        if c.Type[idx] == BlockAir {
+          continue
+        }
+        c.Meta[idx] = (c.Meta[idx] &^ (biomeMetaMask << biomeMetaShift)) | (biome << biomeMetaShift)
+      }
+    }
+  }
+}
+
+func (PassCaves) Name() string     { return "caves" }
+func (PassCaves) ID() uint8        { return 4 }
+func (PassCaves) Reads() []string  { return []string{"terrain", "water"} }
+func (PassCaves) Writes() []string { return []string{"caves"} }
+
+func (PassCaves) Apply(c *chunk.Chunk, ctx PassCtx) {
+  baseY := int32(ctx.Coord.Y) * chunk.CH
+
+  for z := uint8(0); z < chunk.CD; z++ {
+    wz := int32(ctx.Coord.Z)*chunk.CD + int32(z)
+    for x := uint8(0); x < chunk.CW; x++ {
+      wx := int32(ctx.Coord.X)*chunk.CW + int32(x)
+      h := terrainHeight(wx, wz, ctx.Seed)
+
+      // The skin is measured from the lowest of this column and its four
+      // neighbors, so a cave can't open sideways into a lower neighbor's
+      // water or exposed face either.
+      skinTop := h
+      for _, d := range [4][2]int32{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+        if nh := terrainHeight(wx+d[0], wz+d[1], ctx.Seed); nh < skinTop {
+          skinTop = nh
+        }
+      }
+
+      for y := uint8(0); y < chunk.CH; y++ {
+        gy := baseY + int32(y)
+        if gy > seaLevel || skinTop-gy < caveSkinDepth {
+          continue // too shallow: would breach the surface or a water column
+        }
+
+        idx := chunk.Idx(x, y, z)
+        if c.Type[idx] == BlockAir || c.Type[idx] == BlockWater {
+          continue
+        }
+
+        density := noise3D(wx, gy, wz, ctx.Seed^0xCA4E, caveNoiseCell)
+        threshold := caveThresholdAt(h - gy)
+        if density > threshold {
+          c.Type[idx] = BlockAir
+        }
+      }
+    }
+  }
+}
+
+func (PassStructures) Name() string     { return "structures" }
+func (PassStructures) ID() uint8        { return 5 }
+func (PassStructures) Reads() []string  { return []string{"terrain", "water", "biome"} }
+func (PassStructures) Writes() []string { return []string{"structures"} }
+
+func (PassStructures) Apply(c *chunk.Chunk, ctx PassCtx) {
+  // Apply whatever an earlier, already-generated neighbor queued for us
+  // (e.g. leaves from a tree rooted one chunk over) before planting our own.
+  for _, hint := range ctx.Hints.take(ctx.Coord) {
+    c.SetTypeIdx(chunk.IdxFromPacked(hint.Packed), hint.Type)
+    c.SetMetaIdx(chunk.IdxFromPacked(hint.Packed), hint.Meta)
+  }
+
+  baseY := int32(ctx.Coord.Y) * chunk.CH
+
+  for z := uint8(0); z < chunk.CD; z++ {
+    wz := int32(ctx.Coord.Z)*chunk.CD + int32(z)
+    for x := uint8(0); x < chunk.CW; x++ {
+      wx := int32(ctx.Coord.X)*chunk.CW + int32(x)
+      h := terrainHeight(wx, wz, ctx.Seed)
+      if h < seaLevel {
+        continue // underwater column, no surface features
+      }
+      if h < baseY || h >= baseY+chunk.CH {
+        continue // this column's surface isn't in this vertical chunk
+      }
+
+      colHash := mathx.Hash2(ctx.Seed^0x7EE5, wx, wz)
+      switch {
+      case colHash%treeChance == 0:
+        plantTree(c, ctx, h, wx, wz, colHash)
+      case colHash%rockChance == 0:
+        placeRock(c, x, h, z, baseY)
+      }
+    }
+  }
+}
+
+// --- Private helpers ---
+
+// biomeAt assigns a Voronoi region id to the column at (wx,wz): it jitters
+// each nearby cell's center with mathx.Hash2 and takes the id of whichever
+// jittered center is closest, so biome regions are blocky (not per-voxel
+// noise) but still seam-safe across chunk and cell boundaries.
+func biomeAt(seed uint32, wx, wz int32) uint8 {
+  const biomeSalt = uint32(0xB10E0000)
+  cx := floorDiv(wx, biomeCellSize)
+  cz := floorDiv(wz, biomeCellSize)
+
+  bestDist := int64(1) << 62
+  best := uint8(0)
+  for dz := int32(-1); dz <= 1; dz++ {
+    for dx := int32(-1); dx <= 1; dx++ {
+      ccx, ccz := cx+dx, cz+dz
+      h := mathx.Hash2(seed^biomeSalt, ccx, ccz)
+
+      jx := int64(ccx)*int64(biomeCellSize) + int64(h&0xFFFF)*int64(biomeCellSize)/0xFFFF
+      jz := int64(ccz)*int64(biomeCellSize) + int64((h>>16)&0xFFFF)*int64(biomeCellSize)/0xFFFF
+
+      ddx := int64(wx) - jx
+      ddz := int64(wz) - jz
+      dist := ddx*ddx + ddz*ddz
+      if dist < bestDist {
+        bestDist = dist
+        best = uint8(h % numBiomes)
+      }
+    }
+  }
+  return best
+}
+
+// caveThresholdAt returns the noise threshold that must be exceeded to
+// carve air at depthBelowSurface blocks under the column's surface: deeper
+// rock is easier to carve, within a floor so caves don't swallow everything.
+func caveThresholdAt(depthBelowSurface int32) float64 {
+  d := depthBelowSurface
+  if d > caveMaxBonus {
+    d = caveMaxBonus
+  }
+  t := caveBaseThresh - float64(d)*caveFalloff
+  if t < 0.2 {
+    t = 0.2
+  }
+  return t
+}
+
+// plantTree writes a trunk + leaf canopy rooted at world column (wx,wz),
+// surface height h. Any voxel that falls outside ctx.Coord (overhanging
+// canopy, or a trunk poking into the chunk above) is queued as a
+// structureHint for whichever neighbor chunk owns that position.
+func plantTree(c *chunk.Chunk, ctx PassCtx, h int32, wx, wz int32, colHash uint32) {
+  trunkH := int32(trunkMinH) + int32(colHash>>8)%int32(trunkMaxH-trunkMinH+1)
+
+  for dy := int32(1); dy <= trunkH; dy++ {
+    writeStructureVoxel(c, ctx, wx, h+dy, wz, BlockWood, 0)
+  }
+
+  canopyY := h + trunkH
+  const canopyR = 2
+  for dz := int32(-canopyR); dz <= canopyR; dz++ {
+    for dx := int32(-canopyR); dx <= canopyR; dx++ {
+      for dy := int32(-1); dy <= 1; dy++ {
+        if dx*dx+dz*dz+dy*dy > canopyR*canopyR {
+          continue // keep the canopy roughly spherical, not a cube
+        }
+        writeStructureVoxel(c, ctx, wx+dx, canopyY+dy, wz+dz, BlockLeaves, 0)
+      }
+    }
+  }
+}
+
+// placeRock stamps a single surface rock. Rocks are small enough to never
+// overhang a neighbor, so unlike trees they never need a structureHint.
+func placeRock(c *chunk.Chunk, x uint8, h int32, z uint8, baseY int32) {
+  gy := h + 1
+  if gy < baseY || gy >= baseY+chunk.CH {
+    return
+  }
+  idx := chunk.Idx(x, uint8(gy-baseY), z)
+  c.Type[idx] = BlockRock
+}
+
+// writeStructureVoxel writes (type,meta) at world position (wx,wy,wz),
+// either directly into c (if that position is local to ctx.Coord) or as a
+// structureHint queued for whichever chunk owns it.
+func writeStructureVoxel(c *chunk.Chunk, ctx PassCtx, wx, wy, wz int32, t, m uint8) {
+  coord, packed := worldToLocal(wx, wy, wz)
+  if coord == ctx.Coord {
+    c.SetTypeIdx(chunk.IdxFromPacked(packed), t)
+    c.SetMetaIdx(chunk.IdxFromPacked(packed), m)
+    return
+  }
+  ctx.Hints.push(coord, structureHint{Packed: packed, Type: t, Meta: m})
+}
+
+// worldToLocal splits a world-space voxel position into its owning
+// ChunkCoord and the packed local position within it.
+func worldToLocal(wx, wy, wz int32) (coord chunk.ChunkCoord, packed uint16) {
+  cx := floorDiv(wx, chunk.CW)
+  cy := floorDiv(wy, chunk.CH)
+  cz := floorDiv(wz, chunk.CD)
+
+  lx := wx - cx*chunk.CW
+  ly := wy - cy*chunk.CH
+  lz := wz - cz*chunk.CD
+
+  coord = chunk.ChunkCoord{X: cx, Y: cy, Z: cz}
+  packed = chunk.Pack(uint8(lx), uint8(ly), uint8(lz))
+  return coord, packed
+}
@@ -1,6 +1,15 @@
 // internal/gen/pipeline.go
-// Purpose: deterministic generation pipeline; ordered passes.
-// For now: base terrain + water + simple surface materials.
+// Purpose: deterministic generation pipeline; ordered, pluggable passes.
+//
+// Pipeline.Generate runs every registered Pass over a fresh chunk in a fixed
+// order. Passes declare what chunk data they read/write so the pipeline can
+// fail fast at construction if one is wired in before its dependencies, and
+// each carries a stable ID that folds into PassSetVersion - a fingerprint
+// identifying the exact pass set a chunk was generated with. Nothing in
+// this codebase persists chunks to disk yet, so no load path checks
+// PassSetVersion/CompatibleWith today; they're the seam a future save/load
+// feature hangs its "refuse to load against an incompatible pass set" check
+// on (see World.PassSetVersion).
 
 package gen
 
@@ -8,17 +17,21 @@ import (
   "math"
 
   "github.com/Conwinds/NPCSim/internal/chunk"
+  "github.com/Conwinds/NPCSim/internal/mathx"
 )
 
 // --- Constants ---
 
 const (
   // Keep IDs tiny and stable. 0 must be air.
-  BlockAir  = uint8(0)
-  BlockGrass= uint8(1)
-  BlockDirt = uint8(2)
-  BlockStone= uint8(3)
-  BlockWater= uint8(4)
+  BlockAir    = uint8(0)
+  BlockGrass  = uint8(1)
+  BlockDirt   = uint8(2)
+  BlockStone  = uint8(3)
+  BlockWater  = uint8(4)
+  BlockWood   = uint8(5)
+  BlockLeaves = uint8(6)
+  BlockRock   = uint8(7)
 
   seaLevel = 12 // global Y level where water fills up to
 )
@@ -29,64 +42,107 @@ type Context struct {
   Seed uint32
 }
 
-// --- Public methods ---
+// PassCtx is the per-chunk context handed to every Pass.
+type PassCtx struct {
+  Coord chunk.ChunkCoord
+  Seed  uint32
 
-func GenerateChunk(coord chunk.ChunkCoord, ctx Context) *chunk.Chunk {
-  ch := chunk.New(coord)
+  // Hints carries cross-chunk writes (e.g. tree leaves hanging over a
+  // chunk boundary) between Pipeline.Generate calls. Shared across every
+  // chunk the same Pipeline generates.
+  Hints *structureHints
+}
 
-  // World-space base Y for this vertical chunk.
-  baseY := int32(coord.Y) * chunk.CH
-
-  // Pass 1: terrain solids
-  for z := uint8(0); z < chunk.CD; z++ {
-    wz := int32(coord.Z)*chunk.CD + int32(z)
-    for x := uint8(0); x < chunk.CW; x++ {
-      wx := int32(coord.X)*chunk.CW + int32(x)
-
-      // Height in global block coords.
-      h := terrainHeight(wx, wz, ctx.Seed)
-
-      // Fill this chunk's y-range.
-      for y := uint8(0); y < chunk.CH; y++ {
-        gy := baseY + int32(y)
-        idx := chunk.Idx(x, y, z)
-
-        if gy > h {
-          ch.Type[idx] = BlockAir
-          continue
-        }
-
-        // Simple stratification: top grass, under dirt, then stone.
-        depth := h - gy
-        switch {
-        case depth == 0:
-          ch.Type[idx] = BlockGrass
-        case depth <= 3:
-          ch.Type[idx] = BlockDirt
-        default:
-          ch.Type[idx] = BlockStone
-        }
-      }
+// Pass is one deterministic generation step.
+type Pass interface {
+  Name() string
+  // ID is a small stable integer folded into PassSetVersion. Changing what
+  // a pass writes without bumping ID would let an incompatible save look
+  // compatible, so IDs are never reused for a semantically different pass.
+  ID() uint8
+  // Reads/Writes declare this pass's data dependencies, by domain name
+  // ("terrain", "water", "biome", ...), so Pipeline construction can check
+  // ordering instead of relying on registration order being right by luck.
+  Reads() []string
+  Writes() []string
+  Apply(c *chunk.Chunk, ctx PassCtx)
+}
+
+// Pipeline runs an ordered set of Passes and owns the state, like the
+// structure-hint queue, that needs to outlive any single chunk.
+type Pipeline struct {
+  passes []Pass
+  hints  *structureHints
+}
 
-      // Pass 2: water fill (only for columns below sea level)
-      if h < seaLevel {
-        for gy := h + 1; gy <= seaLevel; gy++ {
-          // Only if that global y falls inside this chunk.
-          if gy < baseY || gy >= baseY+chunk.CH {
-            continue
-          }
-          y := uint8(gy - baseY)
-          idx := chunk.Idx(x, y, z)
-          ch.Type[idx] = BlockWater
-        }
+// --- Constructors ---
+
+// NewPipeline builds a Pipeline from passes in the given order, panicking if
+// any pass's declared Reads() aren't satisfied by an earlier pass's Writes()
+// - this is static wiring, so failing fast at construction beats a silently
+// wrong world generating forever.
+func NewPipeline(passes ...Pass) *Pipeline {
+  available := make(map[string]bool, len(passes)*2)
+  for _, p := range passes {
+    for _, dep := range p.Reads() {
+      if !available[dep] {
+        panic("gen: pass " + p.Name() + " reads \"" + dep + "\" before any pass writes it")
       }
     }
+    for _, w := range p.Writes() {
+      available[w] = true
+    }
   }
+  return &Pipeline{passes: passes, hints: newStructureHints()}
+}
+
+// NewDefaultPipeline builds the standard pass pipeline (terrain, sea fill,
+// biome, caves, structures). Each caller gets its own Pipeline instance -
+// and so its own structure-hint queue (see structureHints) - rather than
+// sharing one process-wide pipeline, so two Worlds generating overlapping
+// coordinates can never leak a queued tree overhang into each other.
+func NewDefaultPipeline() *Pipeline {
+  return NewPipeline(
+    PassTerrain{},
+    PassSeaFill{},
+    PassBiome{},
+    PassCaves{},
+    PassStructures{},
+  )
+}
+
+// --- Public methods ---
 
+// Generate runs every pass in p, in order, over a fresh chunk at coord.
+func (p *Pipeline) Generate(coord chunk.ChunkCoord, ctx Context) *chunk.Chunk {
+  ch := chunk.New(coord)
+  pctx := PassCtx{Coord: coord, Seed: ctx.Seed, Hints: p.hints}
+  for _, pass := range p.passes {
+    pass.Apply(ch, pctx)
+  }
   ch.RebuildTopCache()
   return ch
 }
 
+// PassSetVersion fingerprints the passes in p, in order, by folding their
+// IDs through mathx.Hash32. Two pipelines with the same passes in the same
+// order always agree; any change to the pass set changes the version.
+func (p *Pipeline) PassSetVersion() uint32 {
+  v := uint32(0x9E3779B9)
+  for _, pass := range p.passes {
+    v = mathx.Hash32(v ^ uint32(pass.ID()))
+  }
+  return v
+}
+
+// CompatibleWith reports whether a save recorded with passSetVersion was
+// produced by this exact pass set. A world loader should refuse to load
+// (and instead regenerate, or surface an explicit migration step) rather
+// than mix chunks from an incompatible pass set into one world.
+func (p *Pipeline) CompatibleWith(passSetVersion uint32) bool {
+  return p.PassSetVersion() == passSetVersion
+}
+
 // --- Private helpers ---
 
 func clampI32(v, lo, hi int32) int32 {
@@ -99,6 +155,17 @@ func clampI32(v, lo, hi int32) int32 {
   return v
 }
 
+// floorDiv is integer division that rounds toward negative infinity (unlike
+// Go's native "/", which truncates toward zero), so lattice/cell math stays
+// seam-safe across the origin.
+func floorDiv(a, b int32) int32 {
+  q := a / b
+  if (a%b != 0) && ((a < 0) != (b < 0)) {
+    q--
+  }
+  return q
+}
+
 // terrainHeight returns a global Y height for the column at (wx,wz).
 // Output is intentionally constrained for early visualization.
 func terrainHeight(wx, wz int32, seed uint32) int32 {
@@ -0,0 +1,82 @@
+// internal/gen/pipeline_test.go
+// Purpose: coverage for NewPipeline's dependency check and a no-panic sweep
+// over edge-case coordinates for the default pipeline.
+
+package gen
+
+import (
+  "testing"
+
+  "github.com/Conwinds/NPCSim/internal/chunk"
+)
+
+// fakePass is a minimal Pass for exercising NewPipeline's dependency check
+// without depending on the real terrain/biome/cave passes.
+type fakePass struct {
+  name   string
+  id     uint8
+  reads  []string
+  writes []string
+}
+
+func (p fakePass) Name() string       { return p.name }
+func (p fakePass) ID() uint8          { return p.id }
+func (p fakePass) Reads() []string    { return p.reads }
+func (p fakePass) Writes() []string   { return p.writes }
+func (p fakePass) Apply(*chunk.Chunk, PassCtx) {}
+
+func TestNewPipelinePanicsOnUnsatisfiedDependency(t *testing.T) {
+  defer func() {
+    if recover() == nil {
+      t.Fatal("expected NewPipeline to panic when a pass reads a domain nothing wrote yet")
+    }
+  }()
+  NewPipeline(fakePass{name: "needs-water", id: 1, reads: []string{"water"}})
+}
+
+func TestNewPipelineAcceptsSatisfiedDependency(t *testing.T) {
+  defer func() {
+    if r := recover(); r != nil {
+      t.Fatalf("unexpected panic for a satisfied dependency chain: %v", r)
+    }
+  }()
+  NewPipeline(
+    fakePass{name: "writes-water", id: 1, writes: []string{"water"}},
+    fakePass{name: "reads-water", id: 2, reads: []string{"water"}},
+  )
+}
+
+func TestDefaultPipelineNoPanicOverEdgeCoords(t *testing.T) {
+  p := NewDefaultPipeline()
+  coords := []chunk.ChunkCoord{
+    {X: 0, Y: 0, Z: 0},
+    {X: -1, Y: -1, Z: -1},
+    {X: 1 << 20, Y: 0, Z: -(1 << 20)},
+    {X: -(1 << 20), Y: 1 << 10, Z: 1 << 20},
+    {X: 2147483647, Y: 0, Z: -2147483648},
+  }
+  for _, c := range coords {
+    func() {
+      defer func() {
+        if r := recover(); r != nil {
+          t.Fatalf("Generate(%+v) panicked: %v", c, r)
+        }
+      }()
+      p.Generate(c, Context{Seed: 1337})
+    }()
+  }
+}
+
+func TestPassSetVersionChangesWithPassSet(t *testing.T) {
+  a := NewPipeline(fakePass{name: "a", id: 1})
+  b := NewPipeline(fakePass{name: "a", id: 1}, fakePass{name: "b", id: 2, reads: nil})
+  if a.PassSetVersion() == b.PassSetVersion() {
+    t.Fatal("pipelines with different pass sets should have different PassSetVersion")
+  }
+  if !a.CompatibleWith(a.PassSetVersion()) {
+    t.Fatal("a pipeline should be compatible with its own PassSetVersion")
+  }
+  if a.CompatibleWith(b.PassSetVersion()) {
+    t.Fatal("pipelines with different pass sets should not report compatible")
+  }
+}
@@ -2,25 +2,249 @@
 // Purpose: tick loop orchestration (fixed timestep), calling sim systems + entity updates.
 //
 // Rule: Keep deterministic ordering where possible.
+//
+// Systems never mutate chunks directly mid-tick. Instead each system reads
+// from the pre-tick ChunkView and enqueues EditOps into its own EditRing;
+// at end-of-tick the world drains every ring, in fixed system-registration
+// order, into a single TickCommitBuffer and applies it atomically. That
+// makes replays and network snapshots byte-identical regardless of
+// goroutine interleaving: the only things that decide the outcome are the
+// fixed system order and the (coord,packed) sort used when applying.
 
 package world
 
-// --- Imports ---
-//
-// TODO
+import (
+  "context"
+  "sort"
+  "time"
+
+  "github.com/Conwinds/NPCSim/internal/chunk"
+  "github.com/Conwinds/NPCSim/internal/mathx"
+)
 
 // --- Constants ---
-//
-// TODO: tick rate, budgets
+
+const (
+  defaultTickHz = 20.0
+
+  // Classic fixed-timestep catch-up cap: if a frame callback falls behind by
+  // more than this many ticks' worth of accumulated time, drop the rest
+  // instead of spiraling into ever-longer catch-up bursts.
+  maxFrameSkip = 5
+)
 
 // --- Types ---
-//
-// TODO: TickContext, system registry
+
+// EditOp is a single staged voxel mutation, produced by a system during a
+// tick and applied at the tick boundary.
+type EditOp struct {
+  Coord   chunk.ChunkCoord
+  Packed  uint16
+  NewType uint8
+  NewMeta uint8
+  Cause   string // system name / reason, for debugging and replay logs
+}
+
+// EditRing is the per-system, per-tick queue of EditOps. Each system gets
+// its own ring so concurrent systems never contend on a shared slice.
+type EditRing struct {
+  ops []EditOp
+}
+
+// Enqueue stages op for application at the next tick boundary.
+func (r *EditRing) Enqueue(op EditOp) {
+  r.ops = append(r.ops, op)
+}
+
+// TickCommitBuffer holds every system's ring for the tick currently being
+// resolved.
+type TickCommitBuffer struct {
+  rings map[string]*EditRing
+}
+
+func newTickCommitBuffer() *TickCommitBuffer {
+  return &TickCommitBuffer{rings: make(map[string]*EditRing)}
+}
+
+func (b *TickCommitBuffer) ringFor(sys System) *EditRing {
+  r, ok := b.rings[sys.Name()]
+  if !ok {
+    r = &EditRing{}
+    b.rings[sys.Name()] = r
+  }
+  return r
+}
+
+// ChunkView is the read-only accessor systems use during a tick. It reflects
+// world state as of the start of the tick; edits enqueued this tick are not
+// visible through it until the next tick.
+type ChunkView struct {
+  w *World
+}
+
+// Get returns the type/meta at packed inside the chunk at c, or ok=false if
+// that chunk doesn't exist (yet).
+func (v ChunkView) Get(c chunk.ChunkCoord, packed uint16) (t, m uint8, ok bool) {
+  ch := v.w.peekChunk(c)
+  if ch == nil {
+    return 0, 0, false
+  }
+  t, m = ch.Get(packed)
+  return t, m, true
+}
+
+// TickContext carries the per-tick state systems need: the tick counter, a
+// deterministic RNG stream seeded from the world seed and tick number, and
+// the fixed timestep in seconds.
+type TickContext struct {
+  Tick uint64
+  Dt   float64
+
+  rngState uint32
+}
+
+// Rand draws the next value from this tick's RNG stream. The stream is
+// derived from mathx.Hash32(seed ^ tick), so two runs with the same seed
+// produce byte-identical draws tick-for-tick.
+func (tc *TickContext) Rand() uint32 {
+  tc.rngState = mathx.Hash32(tc.rngState)
+  return tc.rngState
+}
+
+// System is one deterministic simulation pass (machines, world gen
+// follow-ups, future NPCs, ...). Tick must only read through view and
+// ring.Enqueue edits; it must never call Chunk.Set/SetTypeIdx directly.
+type System interface {
+  Name() string
+  Tick(ctx *TickContext, view ChunkView, ring *EditRing)
+}
+
+// editKey identifies a single voxel slot touched within one tick.
+type editKey struct {
+  coord  chunk.ChunkCoord
+  packed uint16
+}
 
 // --- Public methods ---
-//
-// TODO: Step(dt), RunLoop(ctx)
+
+// Step advances the world by exactly one fixed tick: it runs every
+// registered system against the pre-tick view, resolves all staged edits
+// into a single ordered commit, and applies it atomically. It returns the
+// encoded DeltaBatch for the chunks touched this tick (nil if nothing
+// changed), ready for the codec/network layer.
+func (w *World) Step(dt float64) []byte {
+  w.tick++
+  ctx := &TickContext{
+    Tick:     w.tick,
+    Dt:       dt,
+    rngState: mathx.Hash32(w.seed ^ uint32(w.tick)),
+  }
+  view := ChunkView{w: w}
+
+  buf := newTickCommitBuffer()
+  for _, sys := range w.systems {
+    sys.Tick(ctx, view, buf.ringFor(sys))
+  }
+
+  touched := w.applyCommitBuffer(buf)
+  if len(touched) == 0 {
+    return nil
+  }
+  w.notifyDirty(touched)
+  return chunk.EncodeDeltaBatch(touched, w.store)
+}
+
+// RunLoop drives Step at a fixed rate of hz ticks/second until ctx is
+// canceled. It accumulates wall-clock time between frames and runs as many
+// fixed Steps as needed to catch up, capped at maxFrameSkip per frame so a
+// stall doesn't turn into an ever-growing catch-up burst.
+func (w *World) RunLoop(ctx context.Context, hz float64) {
+  if hz <= 0 {
+    hz = defaultTickHz
+  }
+  dt := 1.0 / hz
+
+  ticker := time.NewTicker(time.Duration(dt * float64(time.Second)))
+  defer ticker.Stop()
+
+  last := time.Now()
+  accumulator := 0.0
+
+  for {
+    select {
+    case <-ctx.Done():
+      return
+    case now := <-ticker.C:
+      accumulator += now.Sub(last).Seconds()
+      last = now
+
+      steps := 0
+      for accumulator >= dt && steps < maxFrameSkip {
+        w.Step(dt)
+        accumulator -= dt
+        steps++
+      }
+      if steps == maxFrameSkip {
+        accumulator = 0
+      }
+    }
+  }
+}
 
 // --- Private helpers ---
-//
-// TODO: scheduling, profiling hooks
+
+// applyCommitBuffer resolves every system's ring into one deterministic set
+// of writes and applies them. Conflicts (two systems touching the same
+// voxel) resolve last-writer-wins in system-registration order; the apply
+// order within and across chunks is sorted by (coord, packed) so the result
+// - and the DeltaBatch built from it - never depends on map iteration order
+// or goroutine scheduling.
+func (w *World) applyCommitBuffer(buf *TickCommitBuffer) []*chunk.Chunk {
+  staged := make(map[editKey]EditOp)
+  for _, sys := range w.systems {
+    ring, ok := buf.rings[sys.Name()]
+    if !ok {
+      continue
+    }
+    for _, op := range ring.ops {
+      staged[editKey{op.Coord, op.Packed}] = op
+    }
+  }
+  if len(staged) == 0 {
+    return nil
+  }
+
+  byChunk := make(map[chunk.ChunkCoord][]EditOp, len(staged))
+  for k, op := range staged {
+    byChunk[k.coord] = append(byChunk[k.coord], op)
+  }
+
+  coords := make([]chunk.ChunkCoord, 0, len(byChunk))
+  for c := range byChunk {
+    coords = append(coords, c)
+  }
+  sort.Slice(coords, func(i, j int) bool { return coordLess(coords[i], coords[j]) })
+
+  touched := make([]*chunk.Chunk, 0, len(coords))
+  for _, coord := range coords {
+    ops := byChunk[coord]
+    sort.Slice(ops, func(i, j int) bool { return ops[i].Packed < ops[j].Packed })
+
+    ch := w.GetOrCreateChunk(coord)
+    for _, op := range ops {
+      ch.Set(op.Packed, op.NewType, op.NewMeta)
+    }
+    touched = append(touched, ch)
+  }
+  return touched
+}
+
+func coordLess(a, b chunk.ChunkCoord) bool {
+  if a.X != b.X {
+    return a.X < b.X
+  }
+  if a.Y != b.Y {
+    return a.Y < b.Y
+  }
+  return a.Z < b.Z
+}
@@ -0,0 +1,82 @@
+// internal/world/tick_test.go
+// Purpose: determinism coverage for Step/applyCommitBuffer's conflict
+// resolution and ordering.
+
+package world
+
+import (
+  "testing"
+
+  "github.com/Conwinds/NPCSim/internal/chunk"
+)
+
+// fakeSystem enqueues a fixed set of EditOps every Tick, regardless of what
+// view shows - good enough to drive applyCommitBuffer without a real
+// generation/simulation pass.
+type fakeSystem struct {
+  name string
+  ops  []EditOp
+}
+
+func (s *fakeSystem) Name() string { return s.name }
+
+func (s *fakeSystem) Tick(ctx *TickContext, view ChunkView, ring *EditRing) {
+  for _, op := range s.ops {
+    ring.Enqueue(op)
+  }
+}
+
+func TestStepConflictResolutionIsLastRegisteredWins(t *testing.T) {
+  coord := chunk.ChunkCoord{X: 0, Y: 0, Z: 0}
+  packed := chunk.Pack(1, 2, 3)
+
+  // Both systems write the same voxel; sysB is registered after sysA, so
+  // applyCommitBuffer's last-writer-wins-by-registration-order rule says
+  // sysB's value must win. Both ops share one staged key, so the conflict is
+  // settled while the rings are drained in registration order; the loop
+  // repeats the tick on fresh worlds to confirm the outcome never varies.
+  for i := 0; i < 20; i++ {
+    w := NewWorld(1)
+    w.RegisterSystem(&fakeSystem{name: "a", ops: []EditOp{
+      {Coord: coord, Packed: packed, NewType: 10, NewMeta: 0, Cause: "a"},
+    }})
+    w.RegisterSystem(&fakeSystem{name: "b", ops: []EditOp{
+      {Coord: coord, Packed: packed, NewType: 20, NewMeta: 0, Cause: "b"},
+    }})
+
+    w.Step(1.0 / 20.0)
+
+    ch := w.GetOrCreateChunk(coord)
+    gotType, _ := ch.Get(packed)
+    if gotType != 20 {
+      t.Fatalf("iteration %d: voxel type = %d, want 20 (sysB should win)", i, gotType)
+    }
+  }
+}
+
+func TestStepAppliesMultipleChunksDeterministically(t *testing.T) {
+  coordA := chunk.ChunkCoord{X: 0, Y: 0, Z: 0}
+  coordB := chunk.ChunkCoord{X: 1, Y: 0, Z: 0}
+  packed := chunk.Pack(5, 5, 5)
+
+  var firstDelta []byte
+  for i := 0; i < 10; i++ {
+    w := NewWorld(7)
+    w.RegisterSystem(&fakeSystem{name: "terraform", ops: []EditOp{
+      {Coord: coordB, Packed: packed, NewType: 9, NewMeta: 1, Cause: "terraform"},
+      {Coord: coordA, Packed: packed, NewType: 8, NewMeta: 2, Cause: "terraform"},
+    }})
+
+    delta := w.Step(1.0 / 20.0)
+    if delta == nil {
+      t.Fatalf("iteration %d: expected a non-nil delta batch", i)
+    }
+    if i == 0 {
+      firstDelta = delta
+      continue
+    }
+    if string(delta) != string(firstDelta) {
+      t.Fatalf("iteration %d: delta batch differs from iteration 0; applyCommitBuffer isn't deterministic", i)
+    }
+  }
+}
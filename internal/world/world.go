@@ -4,18 +4,104 @@
 package world
 
 import (
+  "errors"
   "sync"
 
   "github.com/Conwinds/NPCSim/internal/chunk"
   "github.com/Conwinds/NPCSim/internal/gen"
 )
 
+// maxSubscribeChunks caps how many chunks a single Subscribe call will
+// generate and hold. Without this, an unauthenticated /api/stream request
+// naming a huge region (e.g. minX=-2000&maxX=2000) would synchronously
+// generate millions of 64KB chunks that are never evicted - a trivial
+// resource-exhaustion DoS. 4096 comfortably covers a 16x16 chunk view
+// distance stacked several chunks tall.
+const maxSubscribeChunks = 4096
+
+// ErrRegionTooLarge is returned by Subscribe when region spans more than
+// maxSubscribeChunks chunks.
+var ErrRegionTooLarge = errors.New("world: region exceeds max subscribable chunks")
+
 // --- Types ---
 
 type World struct {
   seed uint32
   mu    sync.RWMutex
   chunks map[chunk.ChunkCoord]*chunk.Chunk
+
+  // pipeline generates new chunks for this World only. Each World owns its
+  // own instance (rather than sharing one process-wide pipeline) because a
+  // Pipeline accumulates cross-chunk state - see gen.Pipeline's
+  // structure-hint queue - that must never leak between Worlds.
+  pipeline *gen.Pipeline
+
+  store   chunk.ChunkStore
+  systems []System
+  tick    uint64
+
+  subMu   sync.Mutex
+  nextSub SubID
+  subs    map[SubID]*subscription
+}
+
+// SubID identifies a live World.Subscribe call.
+type SubID uint64
+
+// Region is an inclusive rectangular range of chunk coordinates.
+type Region struct {
+  Min, Max chunk.ChunkCoord
+}
+
+// Contains reports whether c falls inside r.
+func (r Region) Contains(c chunk.ChunkCoord) bool {
+  return c.X >= r.Min.X && c.X <= r.Max.X &&
+    c.Y >= r.Min.Y && c.Y <= r.Max.Y &&
+    c.Z >= r.Min.Z && c.Z <= r.Max.Z
+}
+
+// chunkCount returns the number of chunk coords inside r, computed in int64
+// so an enormous region can be compared against a cap without overflowing
+// first. A region with any axis inverted (Min > Max) is empty.
+func (r Region) chunkCount() int64 {
+  dx := int64(r.Max.X) - int64(r.Min.X) + 1
+  dy := int64(r.Max.Y) - int64(r.Min.Y) + 1
+  dz := int64(r.Max.Z) - int64(r.Min.Z) + 1
+  if dx <= 0 || dy <= 0 || dz <= 0 {
+    return 0
+  }
+  return dx * dy * dz
+}
+
+// FrameKind distinguishes a full chunk snapshot from an incremental delta.
+type FrameKind uint8
+
+const (
+  FrameKeyframe FrameKind = iota
+  FrameDelta
+)
+
+// Frame is one chunk's worth of wire-format bytes pushed to a subscriber:
+// a keyframe (chunk.EncodeChunkSnapshot) or a delta (chunk.EncodeDeltaBatch
+// over just that chunk). Both carry the same codec version byte; a keyframe
+// decodes with chunk.DecodeChunkSnapshot and a delta with
+// chunk.DecodeDeltaBatch.
+type Frame struct {
+  Coord chunk.ChunkCoord
+  Kind  FrameKind
+  Data  []byte
+}
+
+// subscription is one World.Subscribe registration.
+type subscription struct {
+  region Region
+  ch     chan<- Frame
+
+  // needsResync tracks chunks this subscriber fell behind on: once Frame
+  // delivery would block, we stop sending deltas for that chunk and instead
+  // wait to ship a fresh keyframe, so a slow client resyncs instead of the
+  // server growing an unbounded backlog on its behalf.
+  needsResync map[chunk.ChunkCoord]bool
 }
 
 // --- Constructors ---
@@ -24,6 +110,9 @@ func NewWorld(seed uint32) *World {
   return &World{
     seed: seed,
     chunks: make(map[chunk.ChunkCoord]*chunk.Chunk, 256),
+    pipeline: gen.NewDefaultPipeline(),
+    store: chunk.NewMemChunkStore(),
+    subs: make(map[SubID]*subscription),
   }
 }
 
@@ -34,12 +123,7 @@ func (w *World) GetOrCreateChunk(c chunk.ChunkCoord) *chunk.Chunk {
   ch := w.chunks[c]
   w.mu.RUnlock()
   if ch != nil {
-    if !ch.TopValid {
-      // Rebuild derived cache on demand.
-      w.mu.RLock() // chunk itself isn't protected; this is fine for now (single-writer design later)
-      ch.RebuildTopCache()
-      w.mu.RUnlock()
-    }
+    ch.EnsureTopCache()
     return ch
   }
 
@@ -47,9 +131,146 @@ func (w *World) GetOrCreateChunk(c chunk.ChunkCoord) *chunk.Chunk {
   w.mu.Lock()
   // Re-check in case of race.
   if ch = w.chunks[c]; ch == nil {
-    ch = gen.GenerateChunk(c, gen.Context{Seed: w.seed})
+    ch = w.pipeline.Generate(c, gen.Context{Seed: w.seed})
     w.chunks[c] = ch
   }
   w.mu.Unlock()
   return ch
 }
+
+// RegisterSystem adds sys to the fixed tick order. Registration order is the
+// apply order at end-of-tick: a later-registered system's edits win over an
+// earlier one's for the same voxel (last-writer-wins by priority). Call this
+// during setup, before the tick loop starts; the system list isn't safe to
+// mutate concurrently with Step/RunLoop.
+func (w *World) RegisterSystem(sys System) {
+  w.systems = append(w.systems, sys)
+}
+
+// peekChunk returns the chunk at c without generating it, or nil if it
+// doesn't exist yet. Used by ChunkView for the read-only pre-tick view.
+func (w *World) peekChunk(c chunk.ChunkCoord) *chunk.Chunk {
+  w.mu.RLock()
+  ch := w.chunks[c]
+  w.mu.RUnlock()
+  return ch
+}
+
+// Snapshot encodes the current state of the chunk at c (generating it if
+// needed) using the same codec Subscribe's keyframes use, so /api/chunk and
+// /api/stream share one wire format.
+func (w *World) Snapshot(c chunk.ChunkCoord) []byte {
+  return chunk.EncodeChunkSnapshot(w.GetOrCreateChunk(c), w.store)
+}
+
+// PassSetVersion fingerprints the pass set this World generates chunks
+// with (see gen.Pipeline.PassSetVersion). A future save/load feature should
+// persist this alongside a snapshot and refuse to load it back into a
+// World whose PassSetVersion no longer matches - chunk.EncodeChunkSnapshot
+// is wire format for /api/chunk and /api/stream, not a save file, so there
+// is no load path to wire that refusal into yet.
+func (w *World) PassSetVersion() uint32 {
+  return w.pipeline.PassSetVersion()
+}
+
+// Subscribe registers ch to receive Frames for every chunk coord inside
+// region: an immediate keyframe per chunk (generating any that don't exist
+// yet), then a delta Frame each tick a chunk in region is touched. Frame
+// delivery never blocks the tick: a subscriber that can't keep up has
+// deltas dropped until it can accept a resync keyframe (see
+// subscription.needsResync). Subscribe rejects a region spanning more than
+// maxSubscribeChunks chunks rather than generating and holding all of them.
+//
+// The initial keyframe burst runs through the same deliverChunk/needsResync
+// path deltas use, so a burst that overruns ch's buffer marks the dropped
+// coords for resync instead of losing them silently. The subscription is
+// only registered into w.subs (making it visible to notifyDirty) once the
+// burst finishes, so a concurrent tick can never deliver a delta for a
+// chunk this subscriber hasn't received a keyframe for yet.
+func (w *World) Subscribe(region Region, ch chan<- Frame) (SubID, error) {
+  if region.chunkCount() > maxSubscribeChunks {
+    return 0, ErrRegionTooLarge
+  }
+  sub := &subscription{region: region, ch: ch}
+
+  for x := region.Min.X; x <= region.Max.X; x++ {
+    for y := region.Min.Y; y <= region.Max.Y; y++ {
+      for z := region.Min.Z; z <= region.Max.Z; z++ {
+        coord := chunk.ChunkCoord{X: x, Y: y, Z: z}
+        w.deliverChunk(sub, w.GetOrCreateChunk(coord), true)
+      }
+    }
+  }
+
+  w.subMu.Lock()
+  w.nextSub++
+  id := w.nextSub
+  w.subs[id] = sub
+  w.subMu.Unlock()
+  return id, nil
+}
+
+// Unsubscribe ends a subscription started by Subscribe. It does not close
+// ch; the caller owns that.
+func (w *World) Unsubscribe(id SubID) {
+  w.subMu.Lock()
+  delete(w.subs, id)
+  w.subMu.Unlock()
+}
+
+// --- Private helpers ---
+
+// notifyDirty pushes one coalesced Frame per touched chunk to every
+// subscription whose region contains it. Called once per tick with the
+// chunks Step just applied edits to.
+func (w *World) notifyDirty(touched []*chunk.Chunk) {
+  if len(touched) == 0 {
+    return
+  }
+  w.subMu.Lock()
+  defer w.subMu.Unlock()
+
+  for _, c := range touched {
+    for _, sub := range w.subs {
+      if sub.region.Contains(c.C) {
+        w.deliverChunk(sub, c, false)
+      }
+    }
+  }
+}
+
+// deliverChunk sends sub a Frame for c: a keyframe if forceKeyframe is set
+// or sub previously fell behind on c (sub.needsResync), otherwise a delta.
+// If the send would block, c is marked in sub.needsResync so the next
+// delivery resyncs with a fresh keyframe instead of compounding a delta onto
+// state the subscriber never received.
+func (w *World) deliverChunk(sub *subscription, c *chunk.Chunk, forceKeyframe bool) {
+  var f Frame
+  if forceKeyframe || sub.needsResync[c.C] {
+    f = Frame{Coord: c.C, Kind: FrameKeyframe, Data: chunk.EncodeChunkSnapshot(c, w.store)}
+  } else {
+    f = Frame{Coord: c.C, Kind: FrameDelta, Data: chunk.EncodeDeltaBatch([]*chunk.Chunk{c}, w.store)}
+  }
+
+  if deliverFrame(sub.ch, f) {
+    if sub.needsResync != nil {
+      delete(sub.needsResync, c.C)
+    }
+    return
+  }
+  if sub.needsResync == nil {
+    sub.needsResync = make(map[chunk.ChunkCoord]bool)
+  }
+  sub.needsResync[c.C] = true
+}
+
+// deliverFrame sends f without blocking; it reports whether the send
+// succeeded.
+func deliverFrame(ch chan<- Frame, f Frame) bool {
+  select {
+  case ch <- f:
+    return true
+  default:
+    return false
+  }
+}
@@ -0,0 +1,49 @@
+// internal/world/world_test.go
+// Purpose: coverage for Subscribe's region cap and resync-on-overflow
+// bookkeeping.
+
+package world
+
+import (
+  "testing"
+
+  "github.com/Conwinds/NPCSim/internal/chunk"
+)
+
+func TestSubscribeRejectsRegionOverCap(t *testing.T) {
+  w := NewWorld(1)
+  huge := Region{
+    Min: chunk.ChunkCoord{X: -2000, Y: 0, Z: -2000},
+    Max: chunk.ChunkCoord{X: 2000, Y: 0, Z: 2000},
+  }
+  if _, err := w.Subscribe(huge, make(chan Frame, 8)); err != ErrRegionTooLarge {
+    t.Fatalf("err = %v, want ErrRegionTooLarge", err)
+  }
+}
+
+func TestSubscribeBurstOverflowMarksResyncNotLoss(t *testing.T) {
+  w := NewWorld(1)
+  region := Region{
+    Min: chunk.ChunkCoord{X: 0, Y: 0, Z: 0},
+    Max: chunk.ChunkCoord{X: 9, Y: 0, Z: 9}, // 10x10 = 100 chunks
+  }
+  frames := make(chan Frame, 8) // far smaller than the 100-chunk burst
+
+  id, err := w.Subscribe(region, frames)
+  if err != nil {
+    t.Fatalf("Subscribe: %v", err)
+  }
+
+  w.subMu.Lock()
+  sub := w.subs[id]
+  w.subMu.Unlock()
+
+  delivered := len(frames)
+  resync := len(sub.needsResync)
+  if delivered+resync != 100 {
+    t.Fatalf("delivered=%d resync=%d, want sum 100 (no coord should be silently lost)", delivered, resync)
+  }
+  if resync == 0 {
+    t.Fatal("expected the 8-slot channel to overflow against a 100-chunk burst")
+  }
+}